@@ -0,0 +1,160 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hashchain
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Codec encodes and decodes values of type T to and from a byte stream, used
+// by VariableWriter and VariableReader to store records whose encoded size
+// may differ from record to record.
+type Codec[T any] interface {
+	Encode(w io.Writer, v T) error
+	Decode(r io.Reader) (T, error)
+}
+
+// fixedCodec adapts the fixed-size encode/decode functions used by Writer
+// and Reader into a Codec, for messages whose encoded size never changes.
+type fixedCodec[T any] struct {
+	size   int
+	encode func([]byte, T) (int, error)
+	decode func(*T, []byte) (int, error)
+}
+
+// FixedCodec returns a Codec that always encodes values of type T to exactly
+// size bytes, using encode and decode the same way Writer and Reader do. It
+// is provided so that existing fixed-size encoded messages can be read and
+// written through VariableWriter and VariableReader as well.
+func FixedCodec[T any](size int, encode func([]byte, T) (int, error), decode func(*T, []byte) (int, error)) Codec[T] {
+	return &fixedCodec[T]{size: size, encode: encode, decode: decode}
+}
+
+func (c *fixedCodec[T]) Encode(w io.Writer, v T) error {
+	b := make([]byte, c.size)
+	n, err := c.encode(b, v)
+	if err != nil {
+		return fmt.Errorf("encode: %w", err)
+	}
+	if n != c.size {
+		return ErrIncompleteWrite
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+func (c *fixedCodec[T]) Decode(r io.Reader) (T, error) {
+	var v T
+	b := make([]byte, c.size)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return v, fmt.Errorf("read: %w", err)
+	}
+	_, err := c.decode(&v, b)
+	return v, err
+}
+
+// gobCodec encodes values using encoding/gob.
+type gobCodec[T any] struct{}
+
+// GobCodec returns a Codec that encodes and decodes values of type T using
+// encoding/gob, suitable for arbitrary variable-length Go values.
+func GobCodec[T any]() Codec[T] {
+	return gobCodec[T]{}
+}
+
+func (gobCodec[T]) Encode(w io.Writer, v T) error {
+	return gob.NewEncoder(w).Encode(v)
+}
+
+func (gobCodec[T]) Decode(r io.Reader) (T, error) {
+	var v T
+	err := gob.NewDecoder(r).Decode(&v)
+	return v, err
+}
+
+// jsonCodec encodes values using encoding/json.
+type jsonCodec[T any] struct{}
+
+// JSONCodec returns a Codec that encodes and decodes values of type T using
+// encoding/json.
+func JSONCodec[T any]() Codec[T] {
+	return jsonCodec[T]{}
+}
+
+func (jsonCodec[T]) Encode(w io.Writer, v T) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+func (jsonCodec[T]) Decode(r io.Reader) (T, error) {
+	var v T
+	err := json.NewDecoder(r).Decode(&v)
+	return v, err
+}
+
+// compressedCodec wraps another Codec, compressing its encoded bytes.
+type compressedCodec[T any] struct {
+	codec Codec[T]
+}
+
+// CompressedCodec returns a Codec that gzip-compresses the bytes produced by
+// codec before they are stored, and decompresses them before decoding,
+// useful for larger payloads such as JSON events or protobuf messages.
+//
+// This was requested as a snappy- or zstd-backed codec; it ships gzip
+// instead because this module has no go.mod or dependency management, so
+// pulling in a compression package beyond the standard library isn't
+// currently possible here. gzip is measurably slower and compresses worse
+// than either, so this is a real functional gap, not just a style choice -
+// confirm with the requester whether stdlib-only gzip is acceptable, or
+// whether dependency management should be introduced so an actual snappy/
+// zstd codec can be added.
+func CompressedCodec[T any](codec Codec[T]) Codec[T] {
+	return &compressedCodec[T]{codec: codec}
+}
+
+func (c *compressedCodec[T]) Encode(w io.Writer, v T) error {
+	var buf bytes.Buffer
+	if err := c.codec.Encode(&buf, v); err != nil {
+		return err
+	}
+	gw := gzip.NewWriter(w)
+	if _, err := gw.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("compress: %w", err)
+	}
+	return gw.Close()
+}
+
+func (c *compressedCodec[T]) Decode(r io.Reader) (T, error) {
+	var v T
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return v, fmt.Errorf("decompress: %w", err)
+	}
+	defer gr.Close()
+	return c.codec.Decode(gr)
+}
+
+// RawCodec returns a Codec that stores []byte values as-is, without any
+// additional framing.
+func RawCodec() Codec[[]byte] {
+	return rawCodec{}
+}
+
+type rawCodec struct{}
+
+func (rawCodec) Encode(w io.Writer, v []byte) error {
+	_, err := w.Write(v)
+	return err
+}
+
+func (rawCodec) Decode(r io.Reader) ([]byte, error) {
+	return io.ReadAll(r)
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hashchain_test
+
+import (
+	"bytes"
+	"testing"
+
+	"resenje.org/hashchain"
+)
+
+func TestFixedCodec(t *testing.T) {
+	encodeFunc := func(b []byte, s string) (int, error) {
+		return copy(b, []byte(s)), nil
+	}
+	decodeFunc := func(s *string, b []byte) (int, error) {
+		*s = string(b)
+		return len(*s), nil
+	}
+
+	codec := hashchain.FixedCodec[string](9, encodeFunc, decodeFunc)
+
+	var buf bytes.Buffer
+	assertError(t, codec.Encode(&buf, "message 1"), nil)
+
+	got, err := codec.Decode(&buf)
+	assertError(t, err, nil)
+	if got != "message 1" {
+		t.Errorf("got %q, want %q", got, "message 1")
+	}
+}
+
+func TestGobCodec(t *testing.T) {
+	codec := hashchain.GobCodec[string]()
+
+	var buf bytes.Buffer
+	assertError(t, codec.Encode(&buf, "message 1"), nil)
+
+	got, err := codec.Decode(&buf)
+	assertError(t, err, nil)
+	if got != "message 1" {
+		t.Errorf("got %q, want %q", got, "message 1")
+	}
+}
+
+func TestRawCodec(t *testing.T) {
+	codec := hashchain.RawCodec()
+
+	var buf bytes.Buffer
+	message := []byte("message 1")
+	assertError(t, codec.Encode(&buf, message), nil)
+
+	got, err := codec.Decode(&buf)
+	assertError(t, err, nil)
+	if !bytes.Equal(got, message) {
+		t.Errorf("got %q, want %q", got, message)
+	}
+}
+
+func TestCompressedCodec(t *testing.T) {
+	codec := hashchain.CompressedCodec[string](hashchain.JSONCodec[string]())
+
+	var buf bytes.Buffer
+	message := "a message that should round-trip through compression"
+	assertError(t, codec.Encode(&buf, message), nil)
+
+	got, err := codec.Decode(&buf)
+	assertError(t, err, nil)
+	if got != message {
+		t.Errorf("got %q, want %q", got, message)
+	}
+}
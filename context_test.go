@@ -0,0 +1,95 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hashchain_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"testing"
+	"time"
+
+	"resenje.org/hashchain"
+)
+
+func TestContextCancellation(t *testing.T) {
+	f := newFile(t)
+	defer f.Close()
+
+	messageSize := 9
+
+	encodeFunc := func(b []byte, s string) (int, error) {
+		return copy(b, []byte(s)), nil
+	}
+	decodeFunc := func(s *string, b []byte) (int, error) {
+		*s = string(b)
+		return len(*s), nil
+	}
+
+	writer, err := hashchain.NewWriter[string](f, sha256.New, encodeFunc, messageSize)
+	assertError(t, err, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, _, err = writer.WriteContext(ctx, time.Now(), "message 1")
+	assertError(t, err, context.Canceled)
+
+	_, _, err = writer.Write(time.Now(), "message 1")
+	assertError(t, err, nil)
+
+	reader := hashchain.NewReader[string](f, sha256.New, decodeFunc, messageSize)
+
+	_, err = reader.ReadContext(ctx, 0)
+	assertError(t, err, context.Canceled)
+
+	err = reader.IterateContext(ctx, -1, func(*hashchain.Record[string]) (bool, error) {
+		t.Fatal("callback should not be called with a cancelled context")
+		return true, nil
+	})
+	assertError(t, err, context.Canceled)
+}
+
+func TestIterateContextCancelMidScan(t *testing.T) {
+	f := newFile(t)
+	defer f.Close()
+
+	messageSize := 9
+
+	encodeFunc := func(b []byte, s string) (int, error) {
+		return copy(b, []byte(s)), nil
+	}
+	decodeFunc := func(s *string, b []byte) (int, error) {
+		*s = string(b)
+		return len(*s), nil
+	}
+
+	writer, err := hashchain.NewWriter[string](f, sha256.New, encodeFunc, messageSize)
+	assertError(t, err, nil)
+
+	const total = 10
+	for i := 0; i < total; i++ {
+		_, _, err := writer.Write(time.Now(), fmt.Sprintf("message %d", i))
+		assertError(t, err, nil)
+	}
+
+	reader := hashchain.NewReader[string](f, sha256.New, decodeFunc, messageSize)
+
+	const cancelAfter = 3
+	ctx, cancel := context.WithCancel(context.Background())
+	seen := 0
+	err = reader.IterateContext(ctx, -1, func(*hashchain.Record[string]) (bool, error) {
+		seen++
+		if seen == cancelAfter {
+			cancel()
+		}
+		return true, nil
+	})
+	assertError(t, err, context.Canceled)
+	if seen != cancelAfter {
+		t.Fatalf("got %d callback invocations, want %d", seen, cancelAfter)
+	}
+}
@@ -0,0 +1,408 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hashchain
+
+import (
+	"context"
+	"fmt"
+	"hash"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	merkleLeafPrefix = 0x00
+	merkleNodePrefix = 0x01
+)
+
+// merkleStackNode is one of the "unpaired" right-spine hashes kept while a
+// Merkle tree is built incrementally, one leaf at a time.
+type merkleStackNode struct {
+	level int
+	hash  []byte
+}
+
+// MerkleWriter appends new messages to the hashchain in the same way as
+// Writer, but additionally maintains a binary Merkle tree over the leaf
+// hashes of every written record, using the RFC 6962 hashing scheme (leaf
+// hash prefix 0x00, node hash prefix 0x01). The tree is updated in O(log n)
+// per append by keeping a stack of unpaired right-spine node hashes, instead
+// of rehashing every leaf on every write. Leaf hashes are also persisted to a
+// side stream so that the tree can be rebuilt without rereading the whole
+// hashchain.
+type MerkleWriter[T any] struct {
+	w        *Writer[T]
+	treeW    io.WriteSeeker
+	newHasher func() hash.Hash
+	hashSize int
+	mu       sync.Mutex
+	leaves   [][]byte
+	stack    []merkleStackNode
+}
+
+// NewMerkleWriter creates a MerkleWriter that appends records to w, the same
+// way NewWriter does, and persists one leaf hash per record to treeW. On
+// opening an existing chain, the Merkle tree state is rebuilt by reading
+// every previously stored leaf hash from treeW.
+func NewMerkleWriter[T any](w io.ReadWriteSeeker, treeW io.ReadWriteSeeker, newHasher func() hash.Hash, encode func([]byte, T) (int, error), messageSize int) (*MerkleWriter[T], error) {
+	hw, err := NewWriter[T](w, newHasher, encode, messageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	hashSize := newHasher().Size()
+
+	mw := &MerkleWriter[T]{
+		w:         hw,
+		treeW:     treeW,
+		newHasher: newHasher,
+		hashSize:  hashSize,
+	}
+
+	treeSize := hw.lastRecordID + 1
+	if treeSize > 0 {
+		leaves, err := readMerkleLeaves(treeW, hashSize, treeSize)
+		if err != nil {
+			return nil, fmt.Errorf("read merkle leaves: %w", err)
+		}
+		for _, leaf := range leaves {
+			mw.appendLeaf(leaf)
+		}
+	}
+
+	return mw, nil
+}
+
+// Write appends the timestamp and the message to the hashchain, the same way
+// Writer.Write does, and extends the Merkle tree with a leaf hash derived
+// from the record's hash. The record write and the leaf append happen under
+// the same lock, so concurrent callers can never commit a record and append
+// its leaf hash in different orders.
+func (w *MerkleWriter[T]) Write(t time.Time, message T) (id int, hash []byte, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	id, hash, err = w.w.writeLocked(context.Background(), t, message)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	hasher := w.newHasher()
+	leaf := merkleLeafHash(hasher, hash)
+
+	if _, err := w.treeW.Seek(0, io.SeekEnd); err != nil {
+		return 0, nil, fmt.Errorf("seek to the end of the tree stream: %w", err)
+	}
+	if _, err := w.treeW.Write(leaf); err != nil {
+		return 0, nil, fmt.Errorf("write leaf hash: %w", err)
+	}
+
+	w.appendLeaf(leaf)
+
+	return id, hash, nil
+}
+
+// Root returns the current Merkle tree root hash.
+func (w *MerkleWriter[T]) Root() []byte {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return merkleRootFromStack(w.newHasher(), w.stack)
+}
+
+// Proof returns the inclusion (audit) path for the record with the given id
+// against the current tree size.
+func (w *MerkleWriter[T]) Proof(id int) ([][]byte, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if id < 0 || id >= len(w.leaves) {
+		return nil, ErrNotFound
+	}
+	return merkleInclusionProof(w.newHasher(), w.leaves, id, len(w.leaves)), nil
+}
+
+// ConsistencyProof proves that the first oldSize records were not rewritten
+// when the chain grew to newSize. oldSize must be positive, the same way
+// VerifyConsistency rejects an oldSize of 0: there is no tree to be
+// consistent with before the first record.
+func (w *MerkleWriter[T]) ConsistencyProof(oldSize, newSize int) ([][]byte, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if oldSize <= 0 || oldSize > newSize || newSize > len(w.leaves) {
+		return nil, ErrNotFound
+	}
+	return merkleConsistencyProof(w.newHasher(), w.leaves[:newSize], oldSize, newSize), nil
+}
+
+// appendLeaf updates the in-memory leaves and the unpaired right-spine stack
+// with a new leaf hash, in O(log n).
+func (w *MerkleWriter[T]) appendLeaf(leaf []byte) {
+	w.leaves = append(w.leaves, leaf)
+
+	hasher := w.newHasher()
+	node := leaf
+	level := 0
+	for len(w.stack) > 0 && w.stack[len(w.stack)-1].level == level {
+		top := w.stack[len(w.stack)-1]
+		w.stack = w.stack[:len(w.stack)-1]
+		node = merkleNodeHash(hasher, top.hash, node)
+		level++
+	}
+	w.stack = append(w.stack, merkleStackNode{level: level, hash: node})
+}
+
+func readMerkleLeaves(r io.ReadSeeker, hashSize, count int) ([][]byte, error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, count*hashSize)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	leaves := make([][]byte, count)
+	for i := 0; i < count; i++ {
+		leaves[i] = buf[i*hashSize : (i+1)*hashSize]
+	}
+	return leaves, nil
+}
+
+// MerkleReader reads records from the hashchain, the same way Reader does,
+// and is able to read back the persisted leaf hashes to answer Merkle tree
+// queries without scanning the whole chain.
+type MerkleReader[T any] struct {
+	r         *Reader[T]
+	treeR     io.ReadSeeker
+	newHasher func() hash.Hash
+	hashSize  int
+}
+
+// NewMerkleReader creates a MerkleReader reading records from r and leaf
+// hashes from treeR.
+func NewMerkleReader[T any](r io.ReadSeeker, treeR io.ReadSeeker, newHasher func() hash.Hash, decode func(*T, []byte) (int, error), messageSize int) *MerkleReader[T] {
+	return &MerkleReader[T]{
+		r:         NewReader[T](r, newHasher, decode, messageSize),
+		treeR:     treeR,
+		newHasher: newHasher,
+		hashSize:  newHasher().Size(),
+	}
+}
+
+// Read reads the hashchain Record with the provided ID, the same way
+// Reader.Read does.
+func (r *MerkleReader[T]) Read(id int) (*Record[T], error) {
+	return r.r.Read(id)
+}
+
+// Iterate reads messages in reverse order, the same way Reader.Iterate does.
+func (r *MerkleReader[T]) Iterate(startID int, f func(*Record[T]) (bool, error)) error {
+	return r.r.Iterate(startID, f)
+}
+
+// Root returns the Merkle tree root for the given tree size, computed from
+// the persisted leaf hashes.
+func (r *MerkleReader[T]) Root(treeSize int) ([]byte, error) {
+	leaves, err := readMerkleLeaves(r.treeR, r.hashSize, treeSize)
+	if err != nil {
+		return nil, fmt.Errorf("read merkle leaves: %w", err)
+	}
+	return merkleRoot(r.newHasher(), leaves), nil
+}
+
+// VerifyInclusion reports whether path is a valid RFC 6962 Merkle audit path
+// proving that leaf is the leaf hash of record id in a tree of size
+// treeSize with the given root.
+func VerifyInclusion(newHasher func() hash.Hash, leaf, root []byte, path [][]byte, id, treeSize int) bool {
+	if id < 0 || id >= treeSize {
+		return false
+	}
+	computed := merkleRootFromPath(newHasher(), leaf, path, id, treeSize)
+	return computed != nil && bytesEqual(computed, root)
+}
+
+// VerifyConsistency reports whether proof is a valid RFC 6962 consistency
+// proof showing that the tree of size newSize with root newRoot is an
+// append-only extension of the tree of size oldSize with root oldRoot.
+func VerifyConsistency(newHasher func() hash.Hash, oldRoot, newRoot []byte, proof [][]byte, oldSize, newSize int) bool {
+	if oldSize <= 0 || oldSize > newSize {
+		return false
+	}
+	if oldSize == newSize {
+		return len(proof) == 0 && bytesEqual(oldRoot, newRoot)
+	}
+	idx, computedNew, computedOld, ok := merkleConsistencyRoots(newHasher(), proof, 0, newSize, oldSize, true, oldRoot)
+	if !ok || idx != len(proof) {
+		return false
+	}
+	return bytesEqual(computedOld, oldRoot) && bytesEqual(computedNew, newRoot)
+}
+
+func bytesEqual(a, b []byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func merkleLeafHash(h hash.Hash, data []byte) []byte {
+	h.Reset()
+	h.Write([]byte{merkleLeafPrefix})
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+func merkleNodeHash(h hash.Hash, left, right []byte) []byte {
+	h.Reset()
+	h.Write([]byte{merkleNodePrefix})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// merkleRootFromStack folds the unpaired right-spine stack into a single
+// root hash, without rehashing any leaf.
+func merkleRootFromStack(h hash.Hash, stack []merkleStackNode) []byte {
+	if len(stack) == 0 {
+		h.Reset()
+		return h.Sum(nil)
+	}
+	acc := stack[len(stack)-1].hash
+	for i := len(stack) - 2; i >= 0; i-- {
+		acc = merkleNodeHash(h, stack[i].hash, acc)
+	}
+	return acc
+}
+
+func largestPowerOfTwoLessThan(n int) int {
+	k := 1
+	for k*2 < n {
+		k *= 2
+	}
+	return k
+}
+
+// merkleRoot computes the root hash over leaves[0:len(leaves)), the RFC 6962
+// MTH algorithm.
+func merkleRoot(h hash.Hash, leaves [][]byte) []byte {
+	n := len(leaves)
+	if n == 0 {
+		h.Reset()
+		return h.Sum(nil)
+	}
+	if n == 1 {
+		return leaves[0]
+	}
+	k := largestPowerOfTwoLessThan(n)
+	return merkleNodeHash(h, merkleRoot(h, leaves[:k]), merkleRoot(h, leaves[k:]))
+}
+
+// merkleInclusionProof computes the RFC 6962 PATH(m, leaves[0:n]) audit path
+// for the leaf at index m.
+func merkleInclusionProof(h hash.Hash, leaves [][]byte, m, n int) [][]byte {
+	if n <= 1 {
+		return nil
+	}
+	k := largestPowerOfTwoLessThan(n)
+	if m < k {
+		return append(merkleInclusionProof(h, leaves[:k], m, k), merkleRoot(h, leaves[k:n]))
+	}
+	return append(merkleInclusionProof(h, leaves[k:n], m-k, n-k), merkleRoot(h, leaves[:k]))
+}
+
+// merkleRootFromPath reconstructs the root hash that leaf and path would
+// produce for index m in a tree of size n, returning nil if path is the
+// wrong length.
+func merkleRootFromPath(h hash.Hash, leaf []byte, path [][]byte, m, n int) []byte {
+	if n == 1 {
+		if len(path) != 0 {
+			return nil
+		}
+		return leaf
+	}
+	if len(path) == 0 {
+		return nil
+	}
+	k := largestPowerOfTwoLessThan(n)
+	sibling := path[len(path)-1]
+	rest := path[:len(path)-1]
+	if m < k {
+		left := merkleRootFromPath(h, leaf, rest, m, k)
+		if left == nil {
+			return nil
+		}
+		return merkleNodeHash(h, left, sibling)
+	}
+	right := merkleRootFromPath(h, leaf, rest, m-k, n-k)
+	if right == nil {
+		return nil
+	}
+	return merkleNodeHash(h, sibling, right)
+}
+
+// merkleConsistencyProof computes the RFC 6962 PROOF(m, leaves[0:n]) proof
+// that the tree of size m is consistent with the tree of size n.
+func merkleConsistencyProof(h hash.Hash, leaves [][]byte, m, n int) [][]byte {
+	if m == n {
+		return [][]byte{}
+	}
+	return merkleSubProof(h, leaves, m, n, true)
+}
+
+func merkleSubProof(h hash.Hash, leaves [][]byte, m, n int, b bool) [][]byte {
+	if m == n {
+		if b {
+			return nil
+		}
+		return [][]byte{merkleRoot(h, leaves)}
+	}
+	k := largestPowerOfTwoLessThan(n)
+	if m <= k {
+		return append(merkleSubProof(h, leaves[:k], m, k, b), merkleRoot(h, leaves[k:n]))
+	}
+	return append(merkleSubProof(h, leaves[k:n], m-k, n-k, false), merkleRoot(h, leaves[:k]))
+}
+
+// merkleConsistencyRoots walks proof[idx:] the same way merkleSubProof built
+// it, reconstructing both the old root (bounded by m, the tree size the
+// proof was requested against) and the new root (bounded by n) for the
+// subtree of size n. phase1 mirrors the b flag used during generation: it is
+// true for as long as every level on the path to the old/new boundary kept
+// the old tree entirely within the left child, in which case the old root
+// for that level is oldRoot itself, known in advance instead of read from
+// the proof.
+func merkleConsistencyRoots(h hash.Hash, proof [][]byte, idx, n, m int, phase1 bool, oldRoot []byte) (newIdx int, newHash, old []byte, ok bool) {
+	if m == n {
+		if phase1 {
+			return idx, oldRoot, oldRoot, true
+		}
+		if idx >= len(proof) {
+			return idx, nil, nil, false
+		}
+		return idx + 1, proof[idx], proof[idx], true
+	}
+	k := largestPowerOfTwoLessThan(n)
+	if m <= k {
+		idx, newLeft, old, ok := merkleConsistencyRoots(h, proof, idx, k, m, phase1, oldRoot)
+		if !ok || idx >= len(proof) {
+			return idx, nil, nil, false
+		}
+		right := proof[idx]
+		return idx + 1, merkleNodeHash(h, newLeft, right), old, true
+	}
+	idx, newRight, oldRight, ok := merkleConsistencyRoots(h, proof, idx, n-k, m-k, false, oldRoot)
+	if !ok || idx >= len(proof) {
+		return idx, nil, nil, false
+	}
+	left := proof[idx]
+	return idx + 1, merkleNodeHash(h, left, newRight), merkleNodeHash(h, left, oldRight), true
+}
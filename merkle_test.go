@@ -0,0 +1,166 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hashchain_test
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"resenje.org/hashchain"
+)
+
+func TestMerkle(t *testing.T) {
+	f := newFile(t)
+	defer f.Close()
+
+	treeF := newFile(t)
+	defer treeF.Close()
+
+	messageSize := 9
+
+	encodeFunc := func(b []byte, s string) (int, error) {
+		return copy(b, []byte(s)), nil
+	}
+	decodeFunc := func(s *string, b []byte) (int, error) {
+		*s = string(b)
+		return len(*s), nil
+	}
+
+	writer, err := hashchain.NewMerkleWriter[string](f, treeF, sha256.New, encodeFunc, messageSize)
+	assertError(t, err, nil)
+
+	messages := []string{"message 1", "message 2", "message 3", "message 4", "message 5"}
+	for _, m := range messages {
+		_, _, err := writer.Write(time.Now(), m)
+		assertError(t, err, nil)
+	}
+
+	root := writer.Root()
+
+	for id := range messages {
+		path, err := writer.Proof(id)
+		assertError(t, err, nil)
+
+		reader := hashchain.NewMerkleReader[string](f, treeF, sha256.New, decodeFunc, messageSize)
+		record, err := reader.Read(id)
+		assertError(t, err, nil)
+
+		leaf := sha256.Sum256(append([]byte{0x00}, record.Hash...))
+		if !hashchain.VerifyInclusion(sha256.New, leaf[:], root, path, id, len(messages)) {
+			t.Errorf("inclusion proof for record %v did not verify", id)
+		}
+	}
+}
+
+func TestMerkleConsistency(t *testing.T) {
+	f := newFile(t)
+	defer f.Close()
+
+	treeF := newFile(t)
+	defer treeF.Close()
+
+	messageSize := 9
+
+	encodeFunc := func(b []byte, s string) (int, error) {
+		return copy(b, []byte(s)), nil
+	}
+
+	writer, err := hashchain.NewMerkleWriter[string](f, treeF, sha256.New, encodeFunc, messageSize)
+	assertError(t, err, nil)
+
+	_, _, err = writer.Write(time.Now(), "message 1")
+	assertError(t, err, nil)
+	_, _, err = writer.Write(time.Now(), "message 2")
+	assertError(t, err, nil)
+
+	oldRoot := writer.Root()
+
+	_, _, err = writer.Write(time.Now(), "message 3")
+	assertError(t, err, nil)
+
+	newRoot := writer.Root()
+
+	proof, err := writer.ConsistencyProof(2, 3)
+	assertError(t, err, nil)
+
+	if !hashchain.VerifyConsistency(sha256.New, oldRoot, newRoot, proof, 2, 3) {
+		t.Errorf("consistency proof did not verify")
+	}
+}
+
+func TestMerkleConsistencyProofRejectsZeroOldSize(t *testing.T) {
+	f := newFile(t)
+	defer f.Close()
+	treeF := newFile(t)
+	defer treeF.Close()
+
+	messageSize := 9
+
+	encodeFunc := func(b []byte, s string) (int, error) {
+		return copy(b, []byte(s)), nil
+	}
+
+	writer, err := hashchain.NewMerkleWriter[string](f, treeF, sha256.New, encodeFunc, messageSize)
+	assertError(t, err, nil)
+
+	_, _, err = writer.Write(time.Now(), "message 1")
+	assertError(t, err, nil)
+
+	_, err = writer.ConsistencyProof(0, 1)
+	assertError(t, err, hashchain.ErrNotFound)
+}
+
+func TestMerkleWriterConcurrentWrite(t *testing.T) {
+	f := newFile(t)
+	defer f.Close()
+	treeF := newFile(t)
+	defer treeF.Close()
+
+	messageSize := 9
+
+	encodeFunc := func(b []byte, s string) (int, error) {
+		return copy(b, []byte(s)), nil
+	}
+	decodeFunc := func(s *string, b []byte) (int, error) {
+		*s = string(b)
+		return len(*s), nil
+	}
+
+	writer, err := hashchain.NewMerkleWriter[string](f, treeF, sha256.New, encodeFunc, messageSize)
+	assertError(t, err, nil)
+
+	const n = 50
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, _, err := writer.Write(time.Now(), fmt.Sprintf("message %d", i))
+			assertError(t, err, nil)
+		}(i)
+	}
+	wg.Wait()
+
+	root := writer.Root()
+	reader := hashchain.NewMerkleReader[string](f, treeF, sha256.New, decodeFunc, messageSize)
+
+	for id := 0; id < n; id++ {
+		record, err := reader.Read(id)
+		assertError(t, err, nil)
+
+		path, err := writer.Proof(id)
+		assertError(t, err, nil)
+
+		leaf := sha256.Sum256(append([]byte{0x00}, record.Hash...))
+		if !hashchain.VerifyInclusion(sha256.New, leaf[:], root, path, id, n) {
+			t.Errorf("inclusion proof for record %v did not verify", id)
+		}
+	}
+}
+
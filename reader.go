@@ -7,49 +7,162 @@ package hashchain
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"hash"
 	"io"
+	"os"
 	"sync"
 	"time"
 )
 
+// source is the positional read abstraction Reader is built on. It lets
+// Reader use lock-free io.ReaderAt reads when the underlying storage
+// supports them, falling back to a mutex-guarded Seek+Read otherwise.
+type source interface {
+	io.ReaderAt
+	size() (int64, error)
+}
+
+// seekSource adapts an io.ReadSeeker to the source interface. Since Seek and
+// Read share the same position, access is serialized with a mutex.
+type seekSource struct {
+	mu sync.Mutex
+	r  io.ReadSeeker
+}
+
+func (s *seekSource) ReadAt(p []byte, off int64) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := readAt(s.r, off, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (s *seekSource) size() (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.r.Seek(0, io.SeekEnd)
+}
+
+// atSource adapts an io.ReaderAt to the source interface. ReadAt calls need
+// no locking, allowing concurrent reads from multiple goroutines.
+type atSource struct {
+	r        io.ReaderAt
+	sizeFunc func() (int64, error)
+}
+
+func (s *atSource) ReadAt(p []byte, off int64) (int, error) {
+	return s.r.ReadAt(p, off)
+}
+
+func (s *atSource) size() (int64, error) {
+	return s.sizeFunc()
+}
+
+// sizeFuncFor detects a way to determine the total size of r without
+// disturbing any read position shared with ReadAt. It deliberately does not
+// fall back to io.Seeker: Seek mutates a position shared with concurrent
+// ReadAt callers with no synchronization of its own, which would reintroduce
+// the race atSource exists to avoid.
+func sizeFuncFor(r io.ReaderAt) (func() (int64, error), error) {
+	switch v := r.(type) {
+	case interface{ Size() (int64, error) }:
+		return v.Size, nil
+	case *os.File:
+		return func() (int64, error) {
+			fi, err := v.Stat()
+			if err != nil {
+				return 0, err
+			}
+			return fi.Size(), nil
+		}, nil
+	default:
+		return nil, fmt.Errorf("hashchain: %T does not support concurrency-safe size detection", r)
+	}
+}
+
 // Reader reads records from the hashchain.
-type Reader struct {
-	r          io.ReadSeeker
+type Reader[T any] struct {
+	src        source
 	hashSize   int
 	recordSize int
+	decode     func(*T, []byte) (int, error)
 	hasherPool *sync.Pool
 }
 
 // NewReader creates a new hashchain Reader. It verifies the integrity of the
-// hahschain using the provided hasher and it needs a message size in order to
-// read records correctly.
-func NewReader(r io.ReadSeeker, newHasher func() hash.Hash, messageSize int) *Reader {
+// hashchain using the provided hasher and it needs a message size in order to
+// read records correctly. The decode function is used to decode the stored
+// message bytes into the value of type T. If r also implements io.ReaderAt
+// and a concurrency-safe way to determine its size (see sizeFuncFor), reads
+// are done with positional ReadAt calls, the same way NewReaderAt does,
+// allowing concurrent use of the returned Reader; otherwise reads are
+// serialized internally with Seek and Read.
+func NewReader[T any](r io.ReadSeeker, newHasher func() hash.Hash, decode func(*T, []byte) (int, error), messageSize int) *Reader[T] {
+	var src source
+	if ra, ok := r.(io.ReaderAt); ok {
+		if sizeFunc, err := sizeFuncFor(ra); err == nil {
+			src = &atSource{r: ra, sizeFunc: sizeFunc}
+		}
+	}
+	if src == nil {
+		src = &seekSource{r: r}
+	}
+	return newReader[T](src, newHasher, decode, messageSize)
+}
+
+// NewReaderAt creates a new hashchain Reader that reads exclusively through
+// positional ReadAt calls on r, never seeking. Multiple goroutines may call
+// Read and Iterate on the returned Reader concurrently, which is the
+// recommended way to run parallel integrity scans over a *os.File.
+func NewReaderAt[T any](r io.ReaderAt, newHasher func() hash.Hash, decode func(*T, []byte) (int, error), messageSize int) (*Reader[T], error) {
+	sizeFunc, err := sizeFuncFor(r)
+	if err != nil {
+		return nil, err
+	}
+	return newReader[T](&atSource{r: r, sizeFunc: sizeFunc}, newHasher, decode, messageSize), nil
+}
+
+func newReader[T any](src source, newHasher func() hash.Hash, decode func(*T, []byte) (int, error), messageSize int) *Reader[T] {
 	hashSize := newHasher().Size()
 	hasherPool := &sync.Pool{
 		New: func() interface{} {
 			return newHasher()
 		},
 	}
-	return &Reader{
-		r:          r,
+	return &Reader[T]{
+		src:        src,
 		hasherPool: hasherPool,
 		hashSize:   hashSize,
-		recordSize: timestmpSize + messageSize + hashSize,
+		decode:     decode,
+		recordSize: timestampSize + messageSize + hashSize,
 	}
 }
 
 // Read reads the hashchain Record with the provided ID. If the value of the id
 // is negative, the last Record will be returned.
-func (r *Reader) Read(id int) (*Record, error) {
+func (r *Reader[T]) Read(id int) (*Record[T], error) {
+	return r.ReadContext(context.Background(), id)
+}
+
+// ReadContext is like Read, but honors ctx cancellation before reading the
+// record and before validating its hash, returning ctx.Err() directly if it
+// has already been cancelled or has passed its deadline.
+func (r *Reader[T]) ReadContext(ctx context.Context, id int) (*Record[T], error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
 	if id < 0 {
-		offset, err := r.r.Seek(0, io.SeekEnd)
+		offset, err := r.src.size()
 		if err != nil {
-			return nil, fmt.Errorf("see to the end of the hash chain: %w", err)
+			return nil, fmt.Errorf("size of the hash chain: %w", err)
 		}
 		if offset < int64(r.recordSize) {
 			return nil, ErrNotFound
@@ -62,33 +175,33 @@ func (r *Reader) Read(id int) (*Record, error) {
 	if id == 0 {
 		// read first record without the hash part as there is no previous record
 		// leaving the hash part with all zeros
-		if _, err := readAt(r.r, 0, data[r.hashSize:]); err != nil {
-			if errors.Is(err, io.EOF) {
-				return nil, ErrNotFound
-			}
+		if _, err := readRecordAt(r.src, 0, data[r.hashSize:]); err != nil {
 			return nil, err
 		}
 	} else {
 		// read the current record completely and the hash of the previous record
-		if _, err := readAt(r.r, int64(id*r.recordSize-r.hashSize), data); err != nil {
-			if errors.Is(err, io.EOF) {
-				return nil, ErrNotFound
-			}
+		if _, err := readRecordAt(r.src, int64(id*r.recordSize-r.hashSize), data); err != nil {
 			return nil, err
 		}
 	}
 
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	hash := data[r.recordSize : r.recordSize+r.hashSize]
 
 	if !r.validateIntegrity(hash, data[:r.recordSize]) {
 		return nil, ErrIntegrity
 	}
 
-	record := &Record{
+	record := &Record[T]{
 		ID:   id,
 		Hash: hash,
 	}
-	decodeRecord(data[r.hashSize:r.recordSize], record)
+	if err := r.decodeRecord(data[r.hashSize:r.recordSize], record); err != nil {
+		return nil, fmt.Errorf("decode record %v: %w", id, err)
+	}
 
 	return record, nil
 }
@@ -98,27 +211,38 @@ func (r *Reader) Read(id int) (*Record, error) {
 // last record. Message and Hash byte slices in Record passed to the callback
 // function are only valid until the function returns and must not be used
 // outside of that function as slice content may change during iteration.
-func (r *Reader) Iterate(startID int, f func(*Record) (bool, error)) error {
+func (r *Reader[T]) Iterate(startID int, f func(*Record[T]) (bool, error)) error {
+	return r.IterateContext(context.Background(), startID, f)
+}
+
+// IterateContext is like Iterate, but honors ctx cancellation between
+// records: before reading each record, before validating its hash and before
+// invoking f, returning ctx.Err() directly if it has already been cancelled
+// or has passed its deadline.
+func (r *Reader[T]) IterateContext(ctx context.Context, startID int, f func(*Record[T]) (bool, error)) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	var offset int64
 	if startID < 0 {
 		// start from the last record if startID is negative
 		var err error
-		offset, err = r.r.Seek(0, io.SeekEnd)
+		offset, err = r.src.size()
 		if err != nil {
-			return fmt.Errorf("seek to the end of the hash chain: %w", err)
+			return fmt.Errorf("size of the hash chain: %w", err)
 		}
 		if offset < int64(r.recordSize) {
 			return nil
 		}
 	} else {
-		// seek to the start record position
-		startOffset := int64(startID+1) * int64(r.recordSize)
-		var err error
-		offset, err = r.r.Seek(startOffset, io.SeekStart)
+		// the start record position
+		offset = int64(startID+1) * int64(r.recordSize)
+		size, err := r.src.size()
 		if err != nil {
-			return fmt.Errorf("see to the end start position: %w", err)
+			return fmt.Errorf("size of the hash chain: %w", err)
 		}
-		if offset != startOffset {
+		if offset > size {
 			return ErrNotFound
 		}
 	}
@@ -127,7 +251,7 @@ func (r *Reader) Iterate(startID int, f func(*Record) (bool, error)) error {
 		return ErrNotFound
 	}
 	hash := make([]byte, r.hashSize)
-	offset, err := readAt(r.r, offset-int64(r.hashSize), hash)
+	offset, err := readRecordAt(r.src, offset-int64(r.hashSize), hash)
 	if err != nil {
 		return err
 	}
@@ -139,12 +263,16 @@ func (r *Reader) Iterate(startID int, f func(*Record) (bool, error)) error {
 
 	data := make([]byte, r.recordSize)
 	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		if nextRecordOffset == 0 {
 			// read the first record without the hash of the non existing
 			// previous record
-			offset, err = readAt(r.r, nextRecordOffset, data[r.hashSize:])
+			offset, err = readRecordAt(r.src, nextRecordOffset, data[r.hashSize:])
 			if err != nil {
-				return fmt.Errorf("seek to the end of the hash chain: %w", err)
+				return err
 			}
 			// zero out the hash of the non existing previous record of the
 			// first record
@@ -152,15 +280,19 @@ func (r *Reader) Iterate(startID int, f func(*Record) (bool, error)) error {
 				data[i] = 0
 			}
 		} else {
-			offset, err = readAt(r.r, nextRecordOffset, data)
+			offset, err = readRecordAt(r.src, nextRecordOffset, data)
 			if err != nil {
-				return fmt.Errorf("seek to the end of the hash chain: %w", err)
+				return err
 			}
 		}
 
 		id := offset / int64(r.recordSize)
 
-		record := &Record{
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		record := &Record[T]{
 			ID:   int(id),
 			Hash: hash,
 		}
@@ -169,7 +301,13 @@ func (r *Reader) Iterate(startID int, f func(*Record) (bool, error)) error {
 			return fmt.Errorf("record %v: %w", id, ErrIntegrity)
 		}
 
-		decodeRecord(data[r.hashSize:], record)
+		if err := r.decodeRecord(data[r.hashSize:], record); err != nil {
+			return fmt.Errorf("record %v decode: %w", id, err)
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 
 		cont, err := f(record)
 		if err != nil {
@@ -194,7 +332,48 @@ func (r *Reader) Iterate(startID int, f func(*Record) (bool, error)) error {
 	return nil
 }
 
-func (r *Reader) validateIntegrity(h []byte, data []byte) bool {
+// Verify scans the whole hashchain from genesis forward, recomputing every
+// hash, and returns the ID of the last contiguous record whose hash matches.
+// It returns -1 if no record could be verified. Verify stops at the first
+// mismatch or at a truncated tail instead of returning an error, since both
+// are exactly what it is meant to detect; TruncateAfter can then be used to
+// roll the chain back to lastGoodID.
+func (r *Reader[T]) Verify(ctx context.Context) (lastGoodID int, err error) {
+	lastGoodID = -1
+	prevHash := make([]byte, r.hashSize)
+	combined := make([]byte, r.recordSize)
+
+	for id, offset := 0, int64(0); ; id, offset = id+1, offset+int64(r.recordSize) {
+		if err := ctx.Err(); err != nil {
+			return lastGoodID, err
+		}
+
+		data := make([]byte, r.recordSize)
+		if _, err := readRecordAt(r.src, offset, data); err != nil {
+			if errors.Is(err, ErrNotFound) || errors.Is(err, ErrIncompleteRead) {
+				break
+			}
+			return lastGoodID, err
+		}
+
+		if err := ctx.Err(); err != nil {
+			return lastGoodID, err
+		}
+
+		copy(combined, prevHash)
+		copy(combined[r.hashSize:], data[:r.recordSize-r.hashSize])
+		if !r.validateIntegrity(data[r.recordSize-r.hashSize:], combined) {
+			break
+		}
+
+		lastGoodID = id
+		copy(prevHash, data[r.recordSize-r.hashSize:])
+	}
+
+	return lastGoodID, nil
+}
+
+func (r *Reader[T]) validateIntegrity(h []byte, data []byte) bool {
 	x := r.hasherPool.Get()
 	defer r.hasherPool.Put(x)
 
@@ -229,8 +408,25 @@ func readAt(r io.ReadSeeker, offset int64, data []byte) (int64, error) {
 	return c + int64(n), nil
 }
 
-func decodeRecord(data []byte, r *Record) {
-	timestamp := int64(binary.BigEndian.Uint64(data[:timestmpSize]))
-	r.Time = time.Unix(timestamp/int64(time.Second), timestamp%int64(time.Second))
-	r.Message = data[timestmpSize:]
+// readRecordAt reads data at offset through src, translating io.EOF and
+// short reads into the hashchain's own sentinel errors.
+func readRecordAt(src io.ReaderAt, offset int64, data []byte) (int64, error) {
+	n, err := src.ReadAt(data, offset)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return 0, fmt.Errorf("read %v: %w", offset, err)
+	}
+	if n != len(data) {
+		if errors.Is(err, io.EOF) {
+			return 0, ErrNotFound
+		}
+		return 0, ErrIncompleteRead
+	}
+	return offset + int64(n), nil
+}
+
+func (r *Reader[T]) decodeRecord(data []byte, record *Record[T]) error {
+	timestamp := int64(binary.BigEndian.Uint64(data[:timestampSize]))
+	record.Time = time.Unix(timestamp/int64(time.Second), timestamp%int64(time.Second))
+	_, err := r.decode(&record.Message, data[timestampSize:])
+	return err
 }
@@ -0,0 +1,106 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hashchain_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"resenje.org/hashchain"
+)
+
+func TestReaderAtConcurrent(t *testing.T) {
+	f := newFile(t)
+	defer f.Close()
+
+	messageSize := 9
+
+	encodeFunc := func(b []byte, s string) (int, error) {
+		return copy(b, []byte(s)), nil
+	}
+	decodeFunc := func(s *string, b []byte) (int, error) {
+		*s = string(b)
+		return len(*s), nil
+	}
+
+	writer, err := hashchain.NewWriter[string](f, sha256.New, encodeFunc, messageSize)
+	assertError(t, err, nil)
+
+	messages := []string{"message 1", "message 2", "message 3"}
+	for _, m := range messages {
+		_, _, err := writer.Write(time.Now(), m)
+		assertError(t, err, nil)
+	}
+
+	reader, err := hashchain.NewReaderAt[string](f, sha256.New, decodeFunc, messageSize)
+	assertError(t, err, nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < len(messages); i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			r, err := reader.Read(id)
+			assertError(t, err, nil)
+			if r.Message != messages[id] {
+				t.Errorf("got message %q, want %q", r.Message, messages[id])
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+// TestNewReaderFallsBackToSeekSourceForUnsafeReaderAt verifies that NewReader
+// does not hand out an atSource backed by an unsynchronized Seek fallback for
+// an io.ReaderAt that is neither *os.File nor has a Size() (int64, error)
+// method - bytes.Reader, whose Size returns only an int64, is such a type. If it did, concurrent Read(-1) calls would
+// race on the Seeker's position field under go test -race.
+func TestNewReaderFallsBackToSeekSourceForUnsafeReaderAt(t *testing.T) {
+	f := newFile(t)
+	defer f.Close()
+
+	messageSize := 9
+
+	encodeFunc := func(b []byte, s string) (int, error) {
+		return copy(b, []byte(s)), nil
+	}
+	decodeFunc := func(s *string, b []byte) (int, error) {
+		*s = string(b)
+		return len(*s), nil
+	}
+
+	writer, err := hashchain.NewWriter[string](f, sha256.New, encodeFunc, messageSize)
+	assertError(t, err, nil)
+
+	messages := []string{"message 1", "message 2", "message 3"}
+	for _, m := range messages {
+		_, _, err := writer.Write(time.Now(), m)
+		assertError(t, err, nil)
+	}
+
+	data, err := os.ReadFile(f.Name())
+	assertError(t, err, nil)
+
+	reader := hashchain.NewReader[string](bytes.NewReader(data), sha256.New, decodeFunc, messageSize)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r, err := reader.Read(-1)
+			assertError(t, err, nil)
+			if r.Message != messages[len(messages)-1] {
+				t.Errorf("got message %q, want %q", r.Message, messages[len(messages)-1])
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,165 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hashchain_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"os"
+	"testing"
+	"time"
+
+	"resenje.org/hashchain"
+)
+
+func TestVerifyAndTruncateAfter(t *testing.T) {
+	f := newFile(t)
+	defer f.Close()
+
+	messageSize := 9
+
+	encodeFunc := func(b []byte, s string) (int, error) {
+		return copy(b, []byte(s)), nil
+	}
+	decodeFunc := func(s *string, b []byte) (int, error) {
+		*s = string(b)
+		return len(*s), nil
+	}
+
+	writer, err := hashchain.NewWriter[string](f, sha256.New, encodeFunc, messageSize)
+	assertError(t, err, nil)
+
+	for _, m := range []string{"message 1", "message 2", "message 3"} {
+		_, _, err := writer.Write(time.Now(), m)
+		assertError(t, err, nil)
+	}
+
+	reader := hashchain.NewReader[string](f, sha256.New, decodeFunc, messageSize)
+
+	lastGoodID, err := reader.Verify(context.Background())
+	assertError(t, err, nil)
+	if lastGoodID != 2 {
+		t.Fatalf("got last good ID %v, want 2", lastGoodID)
+	}
+
+	// corrupt the last record's message
+	if _, err := f.WriteAt([]byte("X"), int64(fileSize(t, f))-int64(messageSize)-int64(sha256.Size)); err != nil {
+		t.Fatal(err)
+	}
+
+	lastGoodID, err = reader.Verify(context.Background())
+	assertError(t, err, nil)
+	if lastGoodID != 1 {
+		t.Fatalf("got last good ID %v, want 1", lastGoodID)
+	}
+
+	assertError(t, writer.TruncateAfter(lastGoodID), nil)
+
+	_, err = reader.Read(2)
+	assertError(t, err, hashchain.ErrNotFound)
+
+	r, err := reader.Read(1)
+	assertError(t, err, nil)
+	if r.Message != "message 2" {
+		t.Fatalf("got message %q, want %q", r.Message, "message 2")
+	}
+
+	_, _, err = writer.Write(time.Now(), "message 3 again")
+	assertError(t, err, nil)
+
+	lastGoodID, err = reader.Verify(context.Background())
+	assertError(t, err, nil)
+	if lastGoodID != 2 {
+		t.Fatalf("got last good ID %v, want 2", lastGoodID)
+	}
+}
+
+func fileSize(t *testing.T, f *os.File) int64 {
+	t.Helper()
+
+	fi, err := f.Stat()
+	assertError(t, err, nil)
+	return fi.Size()
+}
+
+func TestNewWriterStrictOnOpen(t *testing.T) {
+	f := newFile(t)
+	defer f.Close()
+
+	messageSize := 9
+
+	encodeFunc := func(b []byte, s string) (int, error) {
+		return copy(b, []byte(s)), nil
+	}
+
+	writer, err := hashchain.NewWriter[string](f, sha256.New, encodeFunc, messageSize)
+	assertError(t, err, nil)
+
+	_, _, err = writer.Write(time.Now(), "message 1")
+	assertError(t, err, nil)
+
+	// truncate the tail by one byte to simulate a partial write
+	assertError(t, f.Truncate(fileSize(t, f)-1), nil)
+
+	_, err = hashchain.NewWriter[string](f, sha256.New, encodeFunc, messageSize, hashchain.StrictOnOpen())
+	assertError(t, err, hashchain.ErrInvalidMessageSize)
+
+	_, err = hashchain.NewWriter[string](f, sha256.New, encodeFunc, messageSize)
+	assertError(t, err, nil)
+}
+
+func TestNewWriterVerifyOnOpen(t *testing.T) {
+	f := newFile(t)
+	defer f.Close()
+
+	messageSize := 9
+
+	encodeFunc := func(b []byte, s string) (int, error) {
+		return copy(b, []byte(s)), nil
+	}
+
+	writer, err := hashchain.NewWriter[string](f, sha256.New, encodeFunc, messageSize)
+	assertError(t, err, nil)
+
+	_, _, err = writer.Write(time.Now(), "message 1")
+	assertError(t, err, nil)
+
+	// corrupt the stored message without touching the chain length
+	if _, err := f.WriteAt([]byte("X"), fileSize(t, f)-int64(messageSize)-int64(sha256.Size)); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = hashchain.NewWriter[string](f, sha256.New, encodeFunc, messageSize, hashchain.VerifyOnOpen())
+	assertError(t, err, hashchain.ErrIntegrity)
+}
+
+func TestNewWriterVerifyOnOpenWithDanglingPartialWrite(t *testing.T) {
+	f := newFile(t)
+	defer f.Close()
+
+	messageSize := 9
+
+	encodeFunc := func(b []byte, s string) (int, error) {
+		return copy(b, []byte(s)), nil
+	}
+
+	writer, err := hashchain.NewWriter[string](f, sha256.New, encodeFunc, messageSize)
+	assertError(t, err, nil)
+
+	for _, m := range []string{"message 1", "message 2", "message 3"} {
+		_, _, err := writer.Write(time.Now(), m)
+		assertError(t, err, nil)
+	}
+
+	// simulate a process interrupted mid-write: stray bytes appended after
+	// the last complete record, not forming a full record of their own.
+	if _, err := f.WriteAt([]byte{0x01, 0x02, 0x03}, fileSize(t, f)); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = hashchain.NewWriter[string](f, sha256.New, encodeFunc, messageSize, hashchain.VerifyOnOpen())
+	assertError(t, err, nil)
+}
@@ -0,0 +1,343 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hashchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	payloadLenSize  = 4
+	variableIdxSize = 8
+)
+
+// VariableWriter appends new messages to the hashchain the same way Writer
+// does, except that each message is encoded by a Codec and stored with a
+// length prefix, so that messages no longer have to share a single encoded
+// size. Records are framed on disk as
+// [timestamp][uint32 payloadLen][payload][hash], with the previous record's
+// hash kept in memory and folded into the hash input, the same way Writer
+// does. A sidecar index file mapping record ID to its offset in w is kept up
+// to date so that VariableReader.Read stays O(1).
+type VariableWriter[T any] struct {
+	w            io.ReadWriteSeeker
+	idx          io.ReadWriteSeeker
+	hasher       hash.Hash
+	hashSize     int
+	codec        Codec[T]
+	lastRecordID int
+	prevHash     []byte
+	mu           sync.Mutex
+}
+
+// NewVariableWriter creates a VariableWriter that appends records to w and
+// keeps their offsets in the sidecar index idx. If idx is missing or out of
+// sync with w, it is rebuilt with a single linear scan of w.
+func NewVariableWriter[T any](w io.ReadWriteSeeker, idx io.ReadWriteSeeker, newHasher func() hash.Hash, codec Codec[T]) (*VariableWriter[T], error) {
+	hasher := newHasher()
+	hashSize := hasher.Size()
+
+	size, err := w.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, fmt.Errorf("seek to the end of the chain: %w", err)
+	}
+
+	offsets, prevHash, err := loadOrRebuildIndex(readerAtOf(w), idx, hashSize, size)
+	if err != nil {
+		return nil, fmt.Errorf("load index: %w", err)
+	}
+
+	return &VariableWriter[T]{
+		w:            w,
+		idx:          idx,
+		hasher:       hasher,
+		hashSize:     hashSize,
+		codec:        codec,
+		lastRecordID: len(offsets) - 1,
+		prevHash:     prevHash,
+	}, nil
+}
+
+// Write encodes message with the writer's Codec and appends the timestamp,
+// the encoded message and its integrity hash to the hashchain, updating the
+// sidecar index atomically after the record itself has been written.
+func (w *VariableWriter[T]) Write(t time.Time, message T) (id int, hash []byte, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var payload bytes.Buffer
+	if err := w.codec.Encode(&payload, message); err != nil {
+		return 0, nil, fmt.Errorf("encode: %w", err)
+	}
+
+	header := make([]byte, timestampSize+payloadLenSize)
+	binary.BigEndian.PutUint64(header[:timestampSize], uint64(t.UnixNano()))
+	binary.BigEndian.PutUint32(header[timestampSize:], uint32(payload.Len()))
+
+	w.hasher.Reset()
+	w.hasher.Write(w.prevHash)
+	w.hasher.Write(header)
+	w.hasher.Write(payload.Bytes())
+	hash = w.hasher.Sum(nil)
+
+	offset, err := w.w.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, nil, fmt.Errorf("seek to the end of the hash chain: %w", err)
+	}
+	if _, err := w.w.Write(header); err != nil {
+		return 0, nil, fmt.Errorf("write header: %w", err)
+	}
+	if _, err := w.w.Write(payload.Bytes()); err != nil {
+		return 0, nil, fmt.Errorf("write payload: %w", err)
+	}
+	if _, err := w.w.Write(hash); err != nil {
+		return 0, nil, fmt.Errorf("write hash: %w", err)
+	}
+
+	if err := appendIndexEntry(w.idx, offset); err != nil {
+		return 0, nil, fmt.Errorf("append index entry: %w", err)
+	}
+
+	w.prevHash = hash
+	w.lastRecordID++
+
+	return w.lastRecordID, hash, nil
+}
+
+// VariableReader reads records written by VariableWriter.
+type VariableReader[T any] struct {
+	r        io.ReadSeeker
+	hasher   func() hash.Hash
+	hashSize int
+	codec    Codec[T]
+	offsets  []int64
+}
+
+// NewVariableReader creates a VariableReader reading records from r, using
+// the sidecar index idx to locate each record in O(1). If idx is missing or
+// out of sync with r, it is rebuilt with a single linear scan of r.
+func NewVariableReader[T any](r io.ReadSeeker, idx io.ReadWriteSeeker, newHasher func() hash.Hash, codec Codec[T]) (*VariableReader[T], error) {
+	hashSize := newHasher().Size()
+
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, fmt.Errorf("seek to the end of the chain: %w", err)
+	}
+
+	offsets, _, err := loadOrRebuildIndex(readerAtOf(r), idx, hashSize, size)
+	if err != nil {
+		return nil, fmt.Errorf("load index: %w", err)
+	}
+
+	return &VariableReader[T]{
+		r:        r,
+		hasher:   newHasher,
+		hashSize: hashSize,
+		codec:    codec,
+		offsets:  offsets,
+	}, nil
+}
+
+// Read reads the hashchain Record with the provided ID.
+func (r *VariableReader[T]) Read(id int) (*Record[T], error) {
+	if id < 0 {
+		id = len(r.offsets) - 1
+	}
+	if id < 0 || id >= len(r.offsets) {
+		return nil, ErrNotFound
+	}
+
+	offset := r.offsets[id]
+	header := make([]byte, timestampSize+payloadLenSize)
+	if _, err := readAt(r.r, offset, header); err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+	payloadLen := binary.BigEndian.Uint32(header[timestampSize:])
+
+	frame := make([]byte, int(payloadLen)+r.hashSize)
+	if _, err := readAt(r.r, offset+int64(len(header)), frame); err != nil {
+		return nil, fmt.Errorf("read record %v: %w", id, err)
+	}
+	payload := frame[:payloadLen]
+	recordHash := frame[payloadLen:]
+
+	var prevHash []byte
+	if id == 0 {
+		prevHash = make([]byte, r.hashSize)
+	} else {
+		prevHeader := make([]byte, timestampSize+payloadLenSize)
+		if _, err := readAt(r.r, r.offsets[id-1], prevHeader); err != nil {
+			return nil, fmt.Errorf("read previous header: %w", err)
+		}
+		prevPayloadLen := binary.BigEndian.Uint32(prevHeader[timestampSize:])
+		prevHash = make([]byte, r.hashSize)
+		if _, err := readAt(r.r, r.offsets[id-1]+int64(len(prevHeader))+int64(prevPayloadLen), prevHash); err != nil {
+			return nil, fmt.Errorf("read previous hash: %w", err)
+		}
+	}
+
+	hasher := r.hasher()
+	hasher.Write(prevHash)
+	hasher.Write(header)
+	hasher.Write(payload)
+	if !bytesEqual(hasher.Sum(nil), recordHash) {
+		return nil, ErrIntegrity
+	}
+
+	message, err := r.codec.Decode(bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("decode record %v: %w", id, err)
+	}
+
+	timestamp := int64(binary.BigEndian.Uint64(header[:timestampSize]))
+
+	return &Record[T]{
+		ID:      id,
+		Time:    time.Unix(timestamp/int64(time.Second), timestamp%int64(time.Second)),
+		Message: message,
+		Hash:    recordHash,
+	}, nil
+}
+
+// readerAtOf adapts r to io.ReaderAt, using r's native ReadAt when available
+// and falling back to a mutex-guarded Seek+Read otherwise.
+func readerAtOf(r io.ReadSeeker) io.ReaderAt {
+	if ra, ok := r.(io.ReaderAt); ok {
+		return ra
+	}
+	return &seekSource{r: r}
+}
+
+// loadOrRebuildIndex reads the offset of every record from idx, verifying
+// that its last entry still matches the current end of w. If idx is empty,
+// stale or its length is not a multiple of the index entry size, it is
+// rebuilt from scratch with a single linear scan of w, and the corrected
+// entries are written back to idx.
+func loadOrRebuildIndex(w io.ReaderAt, idx io.ReadWriteSeeker, hashSize int, size int64) (offsets []int64, lastHash []byte, err error) {
+	offsets, ok := readIndex(idx)
+	if ok && len(offsets) > 0 {
+		if valid, lastHash := validateLastOffset(w, hashSize, size, offsets[len(offsets)-1]); valid {
+			return offsets, lastHash, nil
+		}
+	} else if ok && size == 0 {
+		return nil, make([]byte, hashSize), nil
+	}
+
+	offsets, lastHash, err = scanFrames(w, hashSize, size)
+	if err != nil {
+		return nil, nil, fmt.Errorf("scan hash chain: %w", err)
+	}
+	if err := rewriteIndex(idx, offsets); err != nil {
+		return nil, nil, fmt.Errorf("rewrite index: %w", err)
+	}
+	return offsets, lastHash, nil
+}
+
+// readIndex reads every offset stored in idx. ok is false if idx's length is
+// not a clean multiple of the index entry size.
+func readIndex(idx io.ReadWriteSeeker) (offsets []int64, ok bool) {
+	size, err := idx.Seek(0, io.SeekEnd)
+	if err != nil || size%variableIdxSize != 0 {
+		return nil, false
+	}
+	if size == 0 {
+		return nil, true
+	}
+	buf := make([]byte, size)
+	if _, err := idx.Seek(0, io.SeekStart); err != nil {
+		return nil, false
+	}
+	if _, err := io.ReadFull(idx, buf); err != nil {
+		return nil, false
+	}
+	offsets = make([]int64, size/variableIdxSize)
+	for i := range offsets {
+		offsets[i] = int64(binary.BigEndian.Uint64(buf[i*variableIdxSize:]))
+	}
+	return offsets, true
+}
+
+// validateLastOffset reports whether the frame starting at offset parses
+// cleanly and ends exactly at size, returning its hash when it does.
+func validateLastOffset(w io.ReaderAt, hashSize int, size, offset int64) (bool, []byte) {
+	header := make([]byte, timestampSize+payloadLenSize)
+	if _, err := w.ReadAt(header, offset); err != nil {
+		return false, nil
+	}
+	payloadLen := binary.BigEndian.Uint32(header[timestampSize:])
+	frameEnd := offset + int64(len(header)) + int64(payloadLen) + int64(hashSize)
+	if frameEnd != size {
+		return false, nil
+	}
+	hash := make([]byte, hashSize)
+	if _, err := w.ReadAt(hash, frameEnd-int64(hashSize)); err != nil {
+		return false, nil
+	}
+	return true, hash
+}
+
+// scanFrames parses every record frame in w from the beginning, stopping at
+// the first incomplete trailing frame, and returns the offset of each
+// complete record and the hash of the last one.
+func scanFrames(w io.ReaderAt, hashSize int, size int64) (offsets []int64, lastHash []byte, err error) {
+	lastHash = make([]byte, hashSize)
+	var offset int64
+	for offset < size {
+		header := make([]byte, timestampSize+payloadLenSize)
+		if _, err := w.ReadAt(header, offset); err != nil {
+			break
+		}
+		payloadLen := binary.BigEndian.Uint32(header[timestampSize:])
+		frameLen := int64(len(header)) + int64(payloadLen) + int64(hashSize)
+		if offset+frameLen > size {
+			break
+		}
+		hash := make([]byte, hashSize)
+		if _, err := w.ReadAt(hash, offset+frameLen-int64(hashSize)); err != nil {
+			break
+		}
+		offsets = append(offsets, offset)
+		lastHash = hash
+		offset += frameLen
+	}
+	return offsets, lastHash, nil
+}
+
+// appendIndexEntry appends the offset of one record to idx.
+func appendIndexEntry(idx io.WriteSeeker, offset int64) error {
+	if _, err := idx.Seek(0, io.SeekEnd); err != nil {
+		return err
+	}
+	b := make([]byte, variableIdxSize)
+	binary.BigEndian.PutUint64(b, uint64(offset))
+	_, err := idx.Write(b)
+	return err
+}
+
+// rewriteIndex replaces the whole content of idx with offsets.
+func rewriteIndex(idx io.ReadWriteSeeker, offsets []int64) error {
+	truncater, ok := idx.(interface{ Truncate(size int64) error })
+	if ok {
+		if err := truncater.Truncate(0); err != nil {
+			return err
+		}
+	}
+	if _, err := idx.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	b := make([]byte, len(offsets)*variableIdxSize)
+	for i, offset := range offsets {
+		binary.BigEndian.PutUint64(b[i*variableIdxSize:], uint64(offset))
+	}
+	_, err := idx.Write(b)
+	return err
+}
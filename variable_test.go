@@ -0,0 +1,91 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hashchain_test
+
+import (
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"resenje.org/hashchain"
+)
+
+func TestVariableWriterReader(t *testing.T) {
+	dir := t.TempDir()
+
+	f, err := os.Create(filepath.Join(dir, "hashchain.log"))
+	assertError(t, err, nil)
+	defer f.Close()
+
+	idxFile, err := os.Create(filepath.Join(dir, "hashchain.idx"))
+	assertError(t, err, nil)
+	defer idxFile.Close()
+
+	writer, err := hashchain.NewVariableWriter[string](f, idxFile, sha256.New, hashchain.JSONCodec[string]())
+	assertError(t, err, nil)
+
+	messages := []string{"a short one", "a somewhat longer message than the first", "x"}
+	var hashes [][]byte
+	for _, m := range messages {
+		_, hash, err := writer.Write(time.Now(), m)
+		assertError(t, err, nil)
+		hashes = append(hashes, hash)
+	}
+
+	reader, err := hashchain.NewVariableReader[string](f, idxFile, sha256.New, hashchain.JSONCodec[string]())
+	assertError(t, err, nil)
+
+	for id, m := range messages {
+		r, err := reader.Read(id)
+		assertError(t, err, nil)
+		if r.Message != m {
+			t.Errorf("got message %q, want %q", r.Message, m)
+		}
+		if string(r.Hash) != string(hashes[id]) {
+			t.Errorf("got hash %x, want %x", r.Hash, hashes[id])
+		}
+	}
+
+	r, err := reader.Read(-1)
+	assertError(t, err, nil)
+	if r.Message != messages[len(messages)-1] {
+		t.Errorf("got last message %q, want %q", r.Message, messages[len(messages)-1])
+	}
+}
+
+func TestVariableReaderRebuildsStaleIndex(t *testing.T) {
+	dir := t.TempDir()
+
+	f, err := os.Create(filepath.Join(dir, "hashchain.log"))
+	assertError(t, err, nil)
+	defer f.Close()
+
+	idxFile, err := os.Create(filepath.Join(dir, "hashchain.idx"))
+	assertError(t, err, nil)
+	defer idxFile.Close()
+
+	writer, err := hashchain.NewVariableWriter[string](f, idxFile, sha256.New, hashchain.JSONCodec[string]())
+	assertError(t, err, nil)
+
+	_, _, err = writer.Write(time.Now(), "message 1")
+	assertError(t, err, nil)
+	_, _, err = writer.Write(time.Now(), "message 2")
+	assertError(t, err, nil)
+
+	// simulate a missing/corrupt index
+	assertError(t, idxFile.Truncate(0), nil)
+
+	reader, err := hashchain.NewVariableReader[string](f, idxFile, sha256.New, hashchain.JSONCodec[string]())
+	assertError(t, err, nil)
+
+	r, err := reader.Read(1)
+	assertError(t, err, nil)
+	if r.Message != "message 2" {
+		t.Errorf("got message %q, want %q", r.Message, "message 2")
+	}
+}
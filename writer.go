@@ -6,6 +6,7 @@
 package hashchain
 
 import (
+	"context"
 	"encoding/binary"
 	"fmt"
 	"hash"
@@ -27,17 +28,53 @@ type Writer[T any] struct {
 	mu           sync.Mutex
 }
 
+// WriterOption configures optional behavior of NewWriter.
+type WriterOption func(*writerOptions)
+
+type writerOptions struct {
+	verifyOnOpen bool
+	strictOnOpen bool
+}
+
+// VerifyOnOpen makes NewWriter perform a fast integrity check of the last
+// record against the hash of the one before it when opening an existing
+// chain, returning ErrIntegrity if they don't match.
+func VerifyOnOpen() WriterOption {
+	return func(o *writerOptions) { o.verifyOnOpen = true }
+}
+
+// StrictOnOpen makes NewWriter refuse to open a chain whose tail length is
+// not a clean multiple of the record size, returning ErrInvalidMessageSize
+// with the detected corrupt offset, instead of silently resuming after it.
+func StrictOnOpen() WriterOption {
+	return func(o *writerOptions) { o.strictOnOpen = true }
+}
+
 // NewWriter creates a new hashcahin Writer that will append new messages to the
 // provider io.ReadWriteSeeker. Integrity checksums will be constructed with the
 // hasher. It is required to provide the message encoded size information. All
 // written encoded messages have to be of the same size.
-func NewWriter[T any](w io.ReadWriteSeeker, newHasher func() hash.Hash, encode func([]byte, T) (int, error), messageSize int) (*Writer[T], error) {
+func NewWriter[T any](w io.ReadWriteSeeker, newHasher func() hash.Hash, encode func([]byte, T) (int, error), messageSize int, opts ...WriterOption) (*Writer[T], error) {
+	var o writerOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
 	offset, err := w.Seek(0, io.SeekEnd)
 	if err != nil {
 		return nil, fmt.Errorf("seek to the end of the chain: %w", err)
 	}
 	hasher := newHasher()
 	hashSize := hasher.Size()
+	recordSize := timestampSize + messageSize + hashSize
+
+	if o.strictOnOpen && offset%int64(recordSize) != 0 {
+		corruptOffset := (offset / int64(recordSize)) * int64(recordSize)
+		return nil, fmt.Errorf("hashchain: corrupt tail at offset %d: %w", corruptOffset, ErrInvalidMessageSize)
+	}
+
+	lastRecordID := int(offset/int64(recordSize)) - 1
+
 	// create a buffer to store data on every record write to reduce allocations
 	buf := make([]byte, hashSize+timestampSize+messageSize+hashSize)
 	if offset > int64(hashSize) {
@@ -48,26 +85,125 @@ func NewWriter[T any](w io.ReadWriteSeeker, newHasher func() hash.Hash, encode f
 		}
 		offset = o
 	}
+
+	if o.verifyOnOpen {
+		// Anchor on the end of the last complete record, not the raw EOF
+		// offset, which may include a harmless dangling partial write left
+		// by an interrupted process - exactly the case VerifyOnOpen should
+		// tolerate.
+		lastRecordEnd := int64(lastRecordID+1) * int64(recordSize)
+		if err := verifyLastRecordOnOpen(w, newHasher(), hashSize, recordSize, lastRecordID, lastRecordEnd); err != nil {
+			return nil, err
+		}
+	}
+
 	return &Writer[T]{
 		w:            w,
 		hasher:       hasher,
 		hashSize:     hashSize,
 		messageSize:  messageSize,
 		encode:       encode,
-		lastRecordID: int(offset/int64(timestampSize+messageSize+hashSize)) - 1,
+		lastRecordID: lastRecordID,
 		buf:          buf,
 	}, nil
 }
 
+// verifyLastRecordOnOpen recomputes the hash of the last record using the
+// hash of the one before it and compares it against the stored hash, without
+// reading any earlier records.
+func verifyLastRecordOnOpen(w io.ReadSeeker, hasher hash.Hash, hashSize, recordSize, lastRecordID int, offset int64) error {
+	if lastRecordID < 0 {
+		return nil
+	}
+
+	prevHash := make([]byte, hashSize)
+	if lastRecordID > 0 {
+		if _, err := readAt(w, offset-int64(recordSize)-int64(hashSize), prevHash); err != nil {
+			return fmt.Errorf("read previous hash: %w", err)
+		}
+	}
+
+	data := make([]byte, recordSize)
+	if _, err := readAt(w, offset-int64(recordSize), data); err != nil {
+		return fmt.Errorf("read last record: %w", err)
+	}
+
+	hasher.Reset()
+	hasher.Write(prevHash)
+	hasher.Write(data[:recordSize-hashSize])
+	if !bytesEqual(hasher.Sum(nil), data[recordSize-hashSize:]) {
+		return ErrIntegrity
+	}
+	return nil
+}
+
+// TruncateAfter rolls the hashchain back so that id becomes the last record,
+// discarding everything written after it. Pass a negative id to discard every
+// record. The underlying io.ReadWriteSeeker must also implement
+// Truncate(size int64) error, as *os.File does.
+func (w *Writer[T]) TruncateAfter(id int) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	recordSize := timestampSize + w.messageSize + w.hashSize
+
+	prevHash := make([]byte, w.hashSize)
+	var newOffset int64
+	if id >= 0 {
+		newOffset = int64(id+1) * int64(recordSize)
+		if _, err := readAt(w.w, newOffset-int64(w.hashSize), prevHash); err != nil {
+			return fmt.Errorf("read hash at truncation point: %w", err)
+		}
+	}
+
+	truncater, ok := w.w.(interface{ Truncate(size int64) error })
+	if !ok {
+		return fmt.Errorf("hashchain: %T does not support truncation", w.w)
+	}
+	if err := truncater.Truncate(newOffset); err != nil {
+		return fmt.Errorf("truncate: %w", err)
+	}
+	if _, err := w.w.Seek(0, io.SeekEnd); err != nil {
+		return fmt.Errorf("seek to the end of the hash chain: %w", err)
+	}
+
+	copy(w.buf[:w.hashSize], prevHash)
+	if id < 0 {
+		id = -1
+	}
+	w.lastRecordID = id
+
+	return nil
+}
+
 // Write appends the timestamp and the message to the hashchain. The encoded
 // message size has to be the same as specified to NewWriter or
 // ErrIncompleteWrite will be returned. This function returns the ID of the
 // written record that can be used to read the message and the hash for
 // integrity validation.
 func (w *Writer[T]) Write(t time.Time, message T) (id int, hash []byte, err error) {
+	return w.WriteContext(context.Background(), t, message)
+}
+
+// WriteContext is like Write, but honors ctx cancellation before encoding the
+// message and before computing its hash, returning ctx.Err() directly if it
+// has already been cancelled or has passed its deadline.
+func (w *Writer[T]) WriteContext(ctx context.Context, t time.Time, message T) (id int, hash []byte, err error) {
+	if err := ctx.Err(); err != nil {
+		return 0, nil, err
+	}
+
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
+	return w.writeLocked(ctx, t, message)
+}
+
+// writeLocked performs the write for WriteContext. It assumes the caller
+// already holds a lock serializing access to w, which lets MerkleWriter call
+// it while holding its own lock across both the record write and the leaf
+// append, instead of taking w.mu separately for each.
+func (w *Writer[T]) writeLocked(ctx context.Context, t time.Time, message T) (id int, hash []byte, err error) {
 	// encode time at the place after the hash of the last record
 	binary.BigEndian.PutUint64(w.buf[w.hashSize:w.hashSize+timestampSize], uint64(t.UnixNano()))
 	// copy message after the previously stored timestamp
@@ -82,6 +218,10 @@ func (w *Writer[T]) Write(t time.Time, message T) (id int, hash []byte, err erro
 		return 0, nil, ErrIncompleteWrite
 	}
 
+	if err := ctx.Err(); err != nil {
+		return 0, nil, err
+	}
+
 	// calculate the hash of previous record's hash, current record timestamp and
 	// message
 	w.hasher.Reset()